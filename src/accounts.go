@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+// defaultProfileName is the profile stored in the original credential
+// file, used until another profile is made the default.
+const defaultProfileName = "default"
+
+// profileNamePattern restricts profile names to what is safe in a file
+// name.
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// checkProfileName returns an error if name cannot be a profile name.
+func checkProfileName(name string) error {
+	if !profileNamePattern.MatchString(name) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	return nil
+}
+
+// defaultProfileFile generates the path of the file that stores the name
+// of the default profile.
+func defaultProfileFile() (string, error) {
+	return credentialsFile("script-go-quickstart-profile")
+}
+
+// defaultProfile returns the profile chosen with accounts set-default.
+func defaultProfile() string {
+	file, err := defaultProfileFile()
+	if err != nil {
+		return defaultProfileName
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return defaultProfileName
+	}
+	name := strings.TrimSpace(string(b))
+	if checkProfileName(name) != nil {
+		return defaultProfileName
+	}
+	return name
+}
+
+// setDefaultProfile stores the name of the default profile.
+func setDefaultProfile(name string) error {
+	file, err := defaultProfileFile()
+	if err != nil {
+		return err
+	}
+	if name == defaultProfileName {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return ioutil.WriteFile(file, []byte(name+"\n"), 0600)
+}
+
+// listProfiles returns the names of the profiles that have a credential
+// file, sorted by name.
+func listProfiles() ([]string, error) {
+	defaultFile, err := tokenCacheFile(defaultProfileName)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	if _, err := os.Stat(defaultFile); err == nil {
+		names = append(names, defaultProfileName)
+	}
+	prefix := strings.TrimSuffix(defaultFile, ".json") + "-"
+	files, err := filepath.Glob(prefix + "*.json")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(strings.TrimPrefix(file, prefix), ".json")
+		if checkProfileName(name) == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// tokenInfo is the response of Google's tokeninfo endpoint.
+type tokenInfo struct {
+	Email     string      `json:"email"`
+	Scope     string      `json:"scope"`
+	ExpiresIn json.Number `json:"expires_in"`
+}
+
+// scopes returns the granted scopes.
+func (info *tokenInfo) scopes() []string {
+	return strings.Fields(info.Scope)
+}
+
+// fetchTokenInfo asks Google which account and scopes an access token
+// belongs to.
+func fetchTokenInfo(client *http.Client, accessToken string) (*tokenInfo, error) {
+	resp, err := client.Get("https://oauth2.googleapis.com/tokeninfo?access_token=" +
+		url.QueryEscape(accessToken))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("tokeninfo: %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	info := &tokenInfo{}
+	if err := json.NewDecoder(resp.Body).Decode(info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// profileToken reads the cached token of the profile and refreshes it if
+// it has expired. The refreshed token is returned but not saved, as with
+// the client returned by getClient.
+func profileToken(ctx context.Context, config *oauth2.Config, base *http.Client, profile string) (*oauth2.Token, error) {
+	file, err := tokenCacheFile(profile)
+	if err != nil {
+		return nil, err
+	}
+	tok, err := tokenFromFile(file)
+	if err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, base)
+	return config.TokenSource(ctx, tok).Token()
+}
+
+// expiryString describes when a token expires.
+func expiryString(expiry time.Time) string {
+	if expiry.IsZero() {
+		return "never"
+	}
+	left := expiry.Sub(time.Now())
+	if left <= 0 {
+		return "expired"
+	}
+	return fmt.Sprintf("%s (in %s)", expiry.Local().Format("2006-01-02 15:04"),
+		left.Truncate(time.Second))
+}
+
+// accountsCommand runs the accounts subcommand given by args.
+func accountsCommand(args []string, opts httpOptions) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: accounts list|add|remove|set-default [profile]")
+	}
+	ctx := context.Background()
+	switch args[0] {
+	case "list":
+		listAccounts(ctx, opts)
+		return
+	}
+
+	if len(args) != 2 {
+		log.Fatalf("Usage: accounts %s <profile>", args[0])
+	}
+	name := args[1]
+	if err := checkProfileName(name); err != nil {
+		log.Fatalf("%v", err)
+	}
+	file, err := tokenCacheFile(name)
+	if err != nil {
+		log.Fatalf("Unable to get path to cached credential file. %v", err)
+	}
+
+	switch args[0] {
+	case "add":
+		if _, err := os.Stat(file); err == nil {
+			log.Fatalf("Profile %s already exists", name)
+		}
+		base := newHTTPClient(opts)
+		tok := getTokenFromWeb(context.WithValue(ctx, oauth2.HTTPClient, base), oauthConfig())
+		saveToken(file, tok)
+	case "remove":
+		if err := os.Remove(file); err != nil {
+			log.Fatalf("Unable to remove profile %s: %v", name, err)
+		}
+		if defaultProfile() == name {
+			if err := setDefaultProfile(defaultProfileName); err != nil {
+				log.Fatalf("Unable to reset the default profile: %v", err)
+			}
+		}
+		fmt.Printf("Removed profile %s\n", name)
+	case "set-default":
+		if _, err := os.Stat(file); err != nil {
+			log.Fatalf("Unknown profile %s", name)
+		}
+		if err := setDefaultProfile(name); err != nil {
+			log.Fatalf("Unable to set the default profile: %v", err)
+		}
+		fmt.Printf("Default profile is now %s\n", name)
+	default:
+		log.Fatalf("Unknown accounts command %q", args[0])
+	}
+}
+
+// listAccounts prints a table of the profiles with the identity, token
+// expiry and granted scopes of each.
+func listAccounts(ctx context.Context, opts httpOptions) {
+	names, err := listProfiles()
+	if err != nil {
+		log.Fatalf("Unable to list profiles: %v", err)
+	}
+	if len(names) == 0 {
+		fmt.Println("No profiles. Add one with: accounts add <profile>")
+		return
+	}
+	config := oauthConfig()
+	base := newHTTPClient(opts)
+	current := defaultProfile()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "DEFAULT\tPROFILE\tACCOUNT\tEXPIRES\tSCOPES")
+	for _, name := range names {
+		mark := ""
+		if name == current {
+			mark = "*"
+		}
+		account, expires, granted := "?", "?", ""
+		if tok, err := profileToken(ctx, config, base, name); err != nil {
+			account = fmt.Sprintf("error: %v", err)
+		} else {
+			expires = expiryString(tok.Expiry)
+			if info, err := fetchTokenInfo(base, tok.AccessToken); err != nil {
+				account = fmt.Sprintf("error: %v", err)
+			} else {
+				if info.Email != "" {
+					account = info.Email
+				}
+				granted = strings.Join(info.scopes(), " ")
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", mark, name, account, expires, granted)
+	}
+	w.Flush()
+}
+
+// whoami prints the account, token expiry and granted scopes of the
+// profile together with the credential file in use.
+func whoami(opts httpOptions, profile string) {
+	file, err := tokenCacheFile(profile)
+	if err != nil {
+		log.Fatalf("Unable to get path to cached credential file. %v", err)
+	}
+	fmt.Printf("Profile: %s\n", profile)
+	fmt.Printf("Credential file: %s %s\n", file, fileStatus(file))
+
+	base := newHTTPClient(opts)
+	tok, err := profileToken(context.Background(), oauthConfig(), base, profile)
+	if err != nil {
+		log.Fatalf("Unable to read token of profile %s: %v", profile, err)
+	}
+	info, err := fetchTokenInfo(base, tok.AccessToken)
+	if err != nil {
+		log.Fatalf("Unable to inspect token: %v", err)
+	}
+	account := info.Email
+	if account == "" {
+		account = "unknown (the token lacks the userinfo.email scope)"
+	}
+	fmt.Printf("Account: %s\n", account)
+	fmt.Printf("Access token expires: %s\n", expiryString(tok.Expiry))
+	if tok.RefreshToken != "" {
+		fmt.Printf("Refresh token: present\n")
+	} else {
+		fmt.Printf("Refresh token: missing\n")
+	}
+	fmt.Printf("Granted scopes:\n")
+	for _, s := range info.scopes() {
+		fmt.Printf("\t%s\n", s)
+	}
+}
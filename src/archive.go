@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archiveSettings is the archive section of the configuration file.
+type archiveSettings struct {
+	Dir string `json:"dir"`
+}
+
+// checkpointFile is the file of the archive directory that lists, for
+// every record written, the number of records and the hash of the newest
+// one. It anchors the chain, which alone cannot show that the newest
+// records were removed.
+const checkpointFile = "checkpoints"
+
+// archiveRecord is the exact request and response of one scripts.run
+// call. Each record holds the hash of the previous one, so that removing
+// or altering a record breaks the chain.
+type archiveRecord struct {
+	Timestamp      time.Time `json:"timestamp"`
+	Method         string    `json:"method"`
+	URL            string    `json:"url"`
+	Request        []byte    `json:"request"`
+	RequestSHA256  string    `json:"requestSha256"`
+	StatusCode     int       `json:"statusCode"`
+	Response       []byte    `json:"response"`
+	ResponseSHA256 string    `json:"responseSha256"`
+	PrevHash       string    `json:"prevHash"`
+	Hash           string    `json:"hash"`
+}
+
+// computeHash returns the SHA-256 of the record without its Hash field.
+func (r archiveRecord) computeHash() (string, error) {
+	r.Hash = ""
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	return sha256Hex(b), nil
+}
+
+// sha256Hex returns the hex SHA-256 of b.
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// archiveStatusKey is the context key of the *archiveStatus of a call.
+type archiveStatusKey struct{}
+
+// archiveStatus receives the error of archiving a scripts.run call made
+// with it in its context.
+type archiveStatus struct {
+	err error
+}
+
+// archiveTransport is an http.RoundTripper that writes the body of every
+// scripts.run request and response to the archive directory. Headers,
+// which carry the access token, are not archived.
+type archiveTransport struct {
+	base http.RoundTripper
+	dir  string
+}
+
+func (a *archiveTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, ":run") {
+		return a.base.RoundTrip(req)
+	}
+	var reqBody []byte
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		reqBody = b
+		// The request must not be modified, so send a copy with the body
+		// that was read.
+		clone := *req
+		clone.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+		req = &clone
+	}
+
+	resp, err := a.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	rec := archiveRecord{
+		Timestamp:      time.Now().UTC(),
+		Method:         req.Method,
+		URL:            req.URL.String(),
+		Request:        reqBody,
+		RequestSHA256:  sha256Hex(reqBody),
+		StatusCode:     resp.StatusCode,
+		Response:       respBody,
+		ResponseSHA256: sha256Hex(respBody),
+	}
+	if err := writeArchiveRecord(a.dir, rec); err != nil {
+		// The script has already run, so hand the response on and leave
+		// the failure to be reported apart from the execution.
+		if status, ok := req.Context().Value(archiveStatusKey{}).(*archiveStatus); ok {
+			status.err = err
+			return resp, nil
+		}
+		return nil, fmt.Errorf("unable to archive execution: %v", err)
+	}
+	return resp, nil
+}
+
+// archiveFiles returns the record files of the archive in the order they
+// were written.
+func archiveFiles(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// readArchiveRecord reads one record file.
+func readArchiveRecord(file string) (*archiveRecord, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	rec := &archiveRecord{}
+	if err := json.Unmarshal(b, rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// writeArchiveRecord chains rec to the last record of the archive,
+// writes it to a new read-only file and appends a checkpoint for it.
+// Existing files are never replaced.
+func writeArchiveRecord(dir string, rec archiveRecord) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	files, err := archiveFiles(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 {
+		last, err := readArchiveRecord(files[len(files)-1])
+		if err != nil {
+			return err
+		}
+		rec.PrevHash = last.Hash
+	}
+	if rec.Hash, err = rec.computeHash(); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := rec.Timestamp.Format("20060102T150405.000000000Z")
+	f, err := os.OpenFile(filepath.Join(dir, name+".json"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0400)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	cp, err := os.OpenFile(filepath.Join(dir, checkpointFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(cp, "%d %s\n", len(files)+1, rec.Hash); err != nil {
+		cp.Close()
+		return err
+	}
+	return cp.Close()
+}
+
+// archiveCheckpoint is a line of the checkpoint file.
+type archiveCheckpoint struct {
+	Line  int
+	Count int
+	Hash  string
+}
+
+// readCheckpoints reads the checkpoint file of the archive. A missing file
+// yields no checkpoints.
+func readCheckpoints(dir string) ([]archiveCheckpoint, error) {
+	f, err := os.Open(filepath.Join(dir, checkpointFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var cps []archiveCheckpoint
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		cp := archiveCheckpoint{Line: line}
+		if _, err := fmt.Sscanf(sc.Text(), "%d %s", &cp.Count, &cp.Hash); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		cps = append(cps, cp)
+	}
+	return cps, sc.Err()
+}
+
+// verifyArchive checks the hashes and the chain of every record in the
+// archive against each other and the checkpoint file, and prints one
+// line per problem. A non-empty head is the hash of a record printed by
+// an earlier verification, which must still be in the chain. The
+// checkpoint file lives next to the records, so whoever can rewrite both
+// can still drop the newest records unnoticed; keeping the printed head
+// elsewhere and passing it back detects that. It returns whether the
+// archive is intact.
+func verifyArchive(dir, head string) bool {
+	files, err := archiveFiles(dir)
+	if err != nil {
+		fmt.Printf("%s: %v\n", dir, err)
+		return false
+	}
+	ok := true
+	prev := ""
+	hashes := make([]string, len(files))
+	for i, file := range files {
+		rec, err := readArchiveRecord(file)
+		if err != nil {
+			fmt.Printf("%s: %v\n", file, err)
+			ok = false
+			prev = ""
+			continue
+		}
+		if sha256Hex(rec.Request) != rec.RequestSHA256 {
+			fmt.Printf("%s: request does not match its hash\n", file)
+			ok = false
+		}
+		if sha256Hex(rec.Response) != rec.ResponseSHA256 {
+			fmt.Printf("%s: response does not match its hash\n", file)
+			ok = false
+		}
+		if hash, err := rec.computeHash(); err != nil || hash != rec.Hash {
+			fmt.Printf("%s: record does not match its hash\n", file)
+			ok = false
+		}
+		if rec.PrevHash != prev {
+			fmt.Printf("%s: previous record is missing or was altered\n", file)
+			ok = false
+		}
+		prev = rec.Hash
+		hashes[i] = rec.Hash
+	}
+
+	cpFile := filepath.Join(dir, checkpointFile)
+	cps, err := readCheckpoints(dir)
+	if err != nil {
+		fmt.Printf("%s: %v\n", cpFile, err)
+		ok = false
+	}
+	for _, cp := range cps {
+		if cp.Count < 1 || cp.Count > len(files) || hashes[cp.Count-1] != cp.Hash {
+			fmt.Printf("%s:%d: record %d is missing or was altered\n", cpFile, cp.Line, cp.Count)
+			ok = false
+		}
+	}
+	if err == nil {
+		if n := len(cps); n > 0 && cps[n-1].Count != len(files) {
+			fmt.Printf("%s: the last checkpoint is of record %d, but the archive has %d records\n",
+				cpFile, cps[n-1].Count, len(files))
+			ok = false
+		} else if n == 0 && len(files) > 0 {
+			fmt.Printf("%s: missing, but the archive has %d records\n", cpFile, len(files))
+			ok = false
+		}
+	}
+
+	if head != "" {
+		found := false
+		for _, h := range hashes {
+			found = found || h == head
+		}
+		if !found {
+			fmt.Printf("%s: no record has the head %s; records were removed or altered\n", dir, head)
+			ok = false
+		}
+	}
+	if ok {
+		if len(hashes) > 0 {
+			fmt.Printf("%s: %d records OK, head %s\n", dir, len(files), hashes[len(hashes)-1])
+		} else {
+			fmt.Printf("%s: %d records OK\n", dir, len(files))
+		}
+	}
+	return ok
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// metadataCacheTTL is how long cached project metadata is used without
+// asking the API whether it has changed.
+var metadataCacheTTL = 10 * time.Minute
+
+// cacheEntry is a cached API response.
+type cacheEntry struct {
+	URL     string    `json:"url"`
+	ETag    string    `json:"etag"`
+	Fetched time.Time `json:"fetched"`
+	Body    []byte    `json:"body"`
+}
+
+// httpError is a non-200 response of an API.
+type httpError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Status, e.Body)
+}
+
+// cacheFile generates the path of the cache entry for a URL fetched on
+// behalf of a profile. Profiles do not share entries, since they may not
+// have access to the same projects.
+func cacheFile(profile, rawurl string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "script-go-quickstart")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(profile + "\n" + rawurl))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// cachedGet issues a GET request for rawurl and returns the response body.
+// A cached body younger than metadataCacheTTL is returned without a
+// request; an older one is revalidated with If-None-Match when the API
+// sent an ETag for it. Cache failures only cost a fresh request.
+func cachedGet(client *http.Client, profile, rawurl string) ([]byte, error) {
+	file, ferr := cacheFile(profile, rawurl)
+	var cached *cacheEntry
+	if ferr == nil {
+		if b, err := ioutil.ReadFile(file); err == nil {
+			entry := &cacheEntry{}
+			if json.Unmarshal(b, entry) == nil && entry.URL == rawurl {
+				cached = entry
+			}
+		}
+	}
+	if cached != nil && time.Since(cached.Fetched) < metadataCacheTTL {
+		return cached.Body, nil
+	}
+
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry *cacheEntry
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		entry = cached
+		entry.Fetched = time.Now()
+	case resp.StatusCode == http.StatusOK:
+		entry = &cacheEntry{
+			URL:     rawurl,
+			ETag:    resp.Header.Get("ETag"),
+			Fetched: time.Now(),
+			Body:    body,
+		}
+	default:
+		return nil, &httpError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       strings.TrimSpace(string(body)),
+		}
+	}
+	if ferr == nil {
+		if b, err := json.Marshal(entry); err == nil {
+			ioutil.WriteFile(file, b, 0600)
+		}
+	}
+	return entry.Body, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// defaultCheckTimeout bounds a check that sets no timeout.
+const defaultCheckTimeout = 30 * time.Second
+
+// Exit statuses of the check command.
+const (
+	checkPassed = 0
+	checkFailed = 1
+	checkError  = 2
+)
+
+// checkConfig is an assertion on the result of an alias, run by the
+// check command.
+type checkConfig struct {
+	// Alias names the function to run.
+	Alias string `json:"alias"`
+	// Parameters, if set, replace the parameters of the alias.
+	Parameters []interface{} `json:"parameters"`
+	// Expect, if set, must equal the result of the function. Without it
+	// the check passes when the function returns without an error.
+	Expect interface{} `json:"expect"`
+	// Timeout bounds the whole check, e.g. "10s".
+	Timeout string `json:"timeout"`
+}
+
+// runCheck runs the named check and prints one line with its outcome.
+// It returns the exit status: 0 when the check passed, 1 when it failed
+// and 2 when it could not be run.
+func runCheck(opts httpOptions, profile string, cfg *appConfig, name string, ropts *runOptions) int {
+	c, ok := cfg.Checks[name]
+	if !ok {
+		fmt.Printf("ERROR %s: no such check\n", name)
+		return checkError
+	}
+	if _, ok := cfg.Aliases[c.Alias]; !ok {
+		fmt.Printf("ERROR %s: undefined alias %q\n", name, c.Alias)
+		return checkError
+	}
+	timeout := defaultCheckTimeout
+	if c.Timeout != "" {
+		d, err := parseAge(c.Timeout)
+		if err != nil {
+			fmt.Printf("ERROR %s: invalid timeout: %v\n", name, err)
+			return checkError
+		}
+		timeout = d
+	}
+
+	t := cfg.resolve(c.Alias, "")
+	if c.Parameters != nil {
+		t.Parameters = c.Parameters
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	// A check must not stop to ask for authorization, so it only uses a
+	// token that is already cached.
+	srv, err := newCachedService(ctx, opts, profile)
+	if err != nil {
+		fmt.Printf("ERROR %s: %v\n", name, err)
+		return checkError
+	}
+	resp, archiveErr, err := execute(ctx, srv, t, ropts)
+	elapsed := time.Since(start).Truncate(time.Millisecond)
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		fmt.Printf("ERROR %s: timed out after %s\n", name, timeout)
+		return checkError
+	case err != nil:
+		fmt.Printf("ERROR %s: %v\n", name, err)
+		return checkError
+	case archiveErr != nil:
+		fmt.Printf("ERROR %s: the function ran but could not be archived: %v\n", name, archiveErr)
+		return checkError
+	case resp.Error != nil:
+		fmt.Printf("FAIL %s: %s (%s)\n", name, scriptErrorMessage(resp.Error), elapsed)
+		return checkFailed
+	}
+	if err := validateResult(t, resp.Response); err != nil {
+		fmt.Printf("FAIL %s: %s (%s)\n", name, strings.Replace(err.Error(), "\n\t", "; ", -1), elapsed)
+		return checkFailed
+	}
+
+	if c.Expect != nil {
+		var r struct {
+			Result interface{} `json:"result"`
+		}
+		if err := json.Unmarshal(resp.Response, &r); err != nil {
+			fmt.Printf("ERROR %s: unable to decode result: %v\n", name, err)
+			return checkError
+		}
+		if !reflect.DeepEqual(r.Result, c.Expect) {
+			got, _ := json.Marshal(r.Result)
+			want, _ := json.Marshal(c.Expect)
+			fmt.Printf("FAIL %s: expected %s, got %s (%s)\n", name, want, got, elapsed)
+			return checkFailed
+		}
+	}
+	fmt.Printf("PASS %s (%s)\n", name, elapsed)
+	return checkPassed
+}
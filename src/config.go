@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultConfigFile is the configuration file read from the working
+	// directory, next to client_secret.json.
+	defaultConfigFile = "config.json"
+
+	// defaultScriptID and defaultFunction are run when no function is given.
+	defaultScriptID = "Mn_YoQoNj_iufS59FmWsY-JgYYRqhh78z"
+	defaultFunction = "getFoldersUnderRoot"
+)
+
+// appConfig is the layout of the configuration file.
+type appConfig struct {
+	Aliases      map[string]*alias         `json:"aliases"`
+	Environments map[string]*environment   `json:"environments"`
+	Checks       map[string]*checkConfig   `json:"checks"`
+	Profiles     map[string]*profileConfig `json:"profiles"`
+	History      historyRetention          `json:"history"`
+	Archive      archiveSettings           `json:"archive"`
+}
+
+// alias gives a short name to a function of a script project.
+// Deployment, if set, is the ID passed to scripts.run instead of Script.
+// ResultSchema, if set, is a JSON Schema the function's result must match.
+type alias struct {
+	Script       string                 `json:"script"`
+	Deployment   string                 `json:"deployment"`
+	Function     string                 `json:"function"`
+	Parameters   []interface{}          `json:"parameters"`
+	DevMode      bool                   `json:"devMode"`
+	ResultSchema map[string]interface{} `json:"resultSchema"`
+}
+
+// environment is a promotion stage such as dev, staging or prod. Script
+// replaces the default script for functions that are not aliases and
+// for environment aliases that name no script. Aliases override the
+// fields of the top-level aliases.
+type environment struct {
+	Script  string                    `json:"script"`
+	Aliases map[string]*aliasOverride `json:"aliases"`
+}
+
+// aliasOverride holds the alias fields an environment sets. Empty fields
+// keep the top-level value, except that setting Script also replaces the
+// deployment.
+type aliasOverride struct {
+	Script       string                 `json:"script"`
+	Deployment   string                 `json:"deployment"`
+	Function     string                 `json:"function"`
+	Parameters   []interface{}          `json:"parameters"`
+	DevMode      *bool                  `json:"devMode"`
+	ResultSchema map[string]interface{} `json:"resultSchema"`
+}
+
+// profileConfig holds the HTTP timeouts used with a credential profile.
+// Empty values keep the defaults of the corresponding flags.
+type profileConfig struct {
+	DialTimeout           string `json:"dialTimeout"`
+	TLSHandshakeTimeout   string `json:"tlsHandshakeTimeout"`
+	ResponseHeaderTimeout string `json:"responseHeaderTimeout"`
+	Timeout               string `json:"timeout"`
+}
+
+// apply sets the timeouts of the profile in opts, except for those given
+// explicitly on the command line. A nil profile changes nothing.
+func (p *profileConfig) apply(opts *httpOptions) error {
+	if p == nil {
+		return nil
+	}
+	settings := []struct {
+		flag  string
+		value string
+		dst   *time.Duration
+	}{
+		{"dial-timeout", p.DialTimeout, &opts.DialTimeout},
+		{"tls-handshake-timeout", p.TLSHandshakeTimeout, &opts.TLSHandshakeTimeout},
+		{"response-header-timeout", p.ResponseHeaderTimeout, &opts.ResponseHeaderTimeout},
+		{"timeout", p.Timeout, &opts.Timeout},
+	}
+	for _, s := range settings {
+		if s.value == "" || flagSet(s.flag) {
+			continue
+		}
+		d, err := parseTimeout(s.value)
+		if err != nil {
+			return err
+		}
+		*s.dst = d
+	}
+	return nil
+}
+
+// parseTimeout parses a non-negative duration such as "30s" or "5m".
+func parseTimeout(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %q", s)
+	}
+	return d, nil
+}
+
+// target is a resolved function to execute.
+type target struct {
+	Name         string
+	ScriptID     string
+	DeploymentID string
+	Function     string
+	Parameters   []interface{}
+	DevMode      bool
+	ResultSchema map[string]interface{}
+}
+
+// runID returns the ID to pass to scripts.run.
+func (t *target) runID() string {
+	if t.DeploymentID != "" {
+		return t.DeploymentID
+	}
+	return t.ScriptID
+}
+
+// loadConfig reads the configuration file.
+// A missing file is not an error and yields an empty configuration.
+func loadConfig(file string) (*appConfig, error) {
+	cfg := &appConfig{}
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.checkEntries(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// checkEntries returns an error for null aliases, environments, checks,
+// profiles or environment aliases, which unmarshal to nil pointers.
+func (c *appConfig) checkEntries() error {
+	for n, a := range c.Aliases {
+		if a == nil {
+			return fmt.Errorf("aliases.%s: expected object, found null", n)
+		}
+	}
+	for n, env := range c.Environments {
+		if env == nil {
+			return fmt.Errorf("environments.%s: expected object, found null", n)
+		}
+		for an, o := range env.Aliases {
+			if o == nil {
+				return fmt.Errorf("environments.%s.aliases.%s: expected object, found null", n, an)
+			}
+		}
+	}
+	for n, check := range c.Checks {
+		if check == nil {
+			return fmt.Errorf("checks.%s: expected object, found null", n)
+		}
+	}
+	for n, p := range c.Profiles {
+		if p == nil {
+			return fmt.Errorf("profiles.%s: expected object, found null", n)
+		}
+	}
+	return nil
+}
+
+// resolve looks name up in the aliases. Names that are not aliases are
+// taken as function names of the script scriptId.
+func (c *appConfig) resolve(name, scriptId string) *target {
+	if a, ok := c.Aliases[name]; ok {
+		return &target{
+			Name:         name,
+			ScriptID:     a.Script,
+			DeploymentID: a.Deployment,
+			Function:     a.Function,
+			Parameters:   a.Parameters,
+			DevMode:      a.DevMode,
+			ResultSchema: a.ResultSchema,
+		}
+	}
+	return &target{Name: name, ScriptID: scriptId, Function: name}
+}
+
+// forEnvironment returns the configuration with the aliases of the named
+// environment applied, and the environment's default script.
+// An empty name returns the configuration unchanged.
+func (c *appConfig) forEnvironment(name string) (*appConfig, string, error) {
+	if name == "" {
+		return c, "", nil
+	}
+	env, ok := c.Environments[name]
+	if !ok {
+		var known []string
+		for n := range c.Environments {
+			known = append(known, n)
+		}
+		sort.Strings(known)
+		return nil, "", fmt.Errorf("unknown environment %q (known: %s)", name, strings.Join(known, ", "))
+	}
+
+	merged := *c
+	merged.Aliases = map[string]*alias{}
+	for n, a := range c.Aliases {
+		merged.Aliases[n] = a
+	}
+	for n, o := range env.Aliases {
+		a := &alias{}
+		if base, ok := c.Aliases[n]; ok {
+			*a = *base
+		}
+		if o.Script != "" {
+			// An inherited deployment belongs to the top-level script.
+			a.Script = o.Script
+			a.Deployment = o.Deployment
+		} else if o.Deployment != "" {
+			a.Deployment = o.Deployment
+		}
+		if o.Function != "" {
+			a.Function = o.Function
+		}
+		if o.Parameters != nil {
+			a.Parameters = o.Parameters
+		}
+		if o.DevMode != nil {
+			a.DevMode = *o.DevMode
+		}
+		if o.ResultSchema != nil {
+			a.ResultSchema = o.ResultSchema
+		}
+		if a.Script == "" {
+			a.Script = env.Script
+		}
+		if a.Script == "" || a.Function == "" {
+			return nil, "", fmt.Errorf("environment %s: alias %s has no script or function", name, n)
+		}
+		merged.Aliases[n] = a
+	}
+	return &merged, env.Script, nil
+}
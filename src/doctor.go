@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// doctor prints the settings this program would use, so that they can be
+// checked or attached to a bug report.
+func doctor(opts httpOptions, profile string) {
+	fmt.Printf("Client secret file: %s\n", fileStatus("client_secret.json"))
+	fmt.Printf("Profile: %s\n", profile)
+	cacheFile, err := tokenCacheFile(profile)
+	if err != nil {
+		fmt.Printf("Credential file: unknown (%v)\n", err)
+	} else {
+		fmt.Printf("Credential file: %s %s\n", cacheFile, fileStatus(cacheFile))
+	}
+
+	fmt.Printf("HTTP settings:\n")
+	fmt.Printf("\tdial timeout: %s\n", durationString(opts.DialTimeout))
+	fmt.Printf("\tTLS handshake timeout: %s\n", durationString(opts.TLSHandshakeTimeout))
+	fmt.Printf("\tresponse header timeout: %s\n", durationString(opts.ResponseHeaderTimeout))
+	fmt.Printf("\trequest timeout: %s\n", durationString(opts.Timeout))
+	if opts.HTTP1 {
+		fmt.Printf("\tprotocol: HTTP/1.1 only\n")
+	} else {
+		fmt.Printf("\tprotocol: HTTP/2 when available\n")
+	}
+	fmt.Printf("\tgzip: %t\n", opts.Gzip)
+	if opts.MaxConnsPerHost > 0 {
+		fmt.Printf("\tmax connections per host: %d\n", opts.MaxConnsPerHost)
+	} else {
+		fmt.Printf("\tmax connections per host: unlimited\n")
+	}
+	if opts.ArchiveDir != "" {
+		fmt.Printf("Archive directory: %s\n", opts.ArchiveDir)
+	}
+}
+
+// fileStatus reports whether the given file exists.
+func fileStatus(file string) string {
+	if _, err := os.Stat(file); err != nil {
+		if os.IsNotExist(err) {
+			return "(missing)"
+		}
+		return fmt.Sprintf("(%v)", err)
+	}
+	return "(found)"
+}
+
+// durationString formats a timeout, where zero means no timeout.
+func durationString(d time.Duration) string {
+	if d == 0 {
+		return "none"
+	}
+	return d.String()
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historyRecord is one line of the run history file.
+type historyRecord struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Name       string    `json:"name"`
+	ScriptID   string    `json:"scriptId"`
+	Function   string    `json:"function"`
+	ParamsHash string    `json:"paramsHash"`
+	Status     string    `json:"status"`
+	DurationMs int64     `json:"durationMs"`
+	ErrorClass string    `json:"errorClass,omitempty"`
+}
+
+// historyRetention limits how much history is kept. Zero values mean
+// no limit.
+type historyRetention struct {
+	MaxAge   string `json:"maxAge"`
+	MaxRows  int    `json:"maxRows"`
+	MaxBytes int64  `json:"maxBytes"`
+}
+
+// enabled reports whether any limit is set.
+func (r historyRetention) enabled() bool {
+	return r.MaxAge != "" || r.MaxRows > 0 || r.MaxBytes > 0
+}
+
+// historyFile generates the run history path/filename.
+// It returns the generated path/filename.
+func historyFile() (string, error) {
+	return credentialsFile("script-go-quickstart-history.jsonl")
+}
+
+// paramsHash returns a hex SHA-256 of the JSON encoded parameters, so that
+// runs with the same parameters can be grouped without storing them.
+func paramsHash(params []interface{}) string {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// recordHistory appends the result of a run to the history file and then
+// applies the retention limits. Failures are logged since the run itself
+// has already happened.
+func recordHistory(t *target, result *runResult, retention historyRetention) {
+	file, err := historyFile()
+	if err != nil {
+		log.Printf("Unable to get path to history file. %v", err)
+		return
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		log.Printf("Unable to open history file: %v", err)
+		return
+	}
+	rec := historyRecord{
+		Timestamp:  result.StartedAt,
+		Name:       t.Name,
+		ScriptID:   result.ScriptID,
+		Function:   result.Function,
+		ParamsHash: paramsHash(t.Parameters),
+		Status:     result.Status,
+		DurationMs: result.DurationMs,
+		ErrorClass: result.ErrorClass,
+	}
+	err = json.NewEncoder(f).Encode(rec)
+	f.Close()
+	if err != nil {
+		log.Printf("Unable to write history file: %v", err)
+		return
+	}
+	if retention.enabled() {
+		if _, err := pruneHistory(retention); err != nil {
+			log.Printf("Unable to prune history file: %v", err)
+		}
+	}
+}
+
+// pruneHistory removes the records that exceed the retention limits,
+// oldest first. It returns the number of records removed.
+func pruneHistory(retention historyRetention) (int, error) {
+	var since time.Time
+	if retention.MaxAge != "" {
+		age, err := parseAge(retention.MaxAge)
+		if err != nil {
+			return 0, err
+		}
+		since = time.Now().Add(-age)
+	}
+	all, err := readHistory(time.Time{})
+	if err != nil {
+		return 0, err
+	}
+
+	var kept [][]byte
+	var size int64
+	for _, rec := range all {
+		if rec.Timestamp.Before(since) {
+			continue
+		}
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return 0, err
+		}
+		kept = append(kept, append(b, '\n'))
+		size += int64(len(b)) + 1
+	}
+	if retention.MaxRows > 0 && len(kept) > retention.MaxRows {
+		for _, b := range kept[:len(kept)-retention.MaxRows] {
+			size -= int64(len(b))
+		}
+		kept = kept[len(kept)-retention.MaxRows:]
+	}
+	for retention.MaxBytes > 0 && size > retention.MaxBytes && len(kept) > 0 {
+		size -= int64(len(kept[0]))
+		kept = kept[1:]
+	}
+	removed := len(all) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, rewriteHistory(kept)
+}
+
+// rewriteHistory replaces the history file with the given lines. The new
+// content is written to a temporary file first so that a failure leaves
+// the old history in place.
+func rewriteHistory(lines [][]byte) error {
+	file, err := historyFile()
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(file), "history")
+	if err != nil {
+		return err
+	}
+	for _, b := range lines {
+		if _, err = f.Write(b); err != nil {
+			break
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), file)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// readHistory returns the records in the history file that were started
+// at or after since. A missing file has no records.
+func readHistory(since time.Time) ([]historyRecord, error) {
+	file, err := historyFile()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []historyRecord
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var rec historyRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, line, err)
+		}
+		if !rec.Timestamp.Before(since) {
+			records = append(records, rec)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// parseAge parses a non-negative duration that may also be given in
+// days, e.g. "30d".
+func parseAge(s string) (time.Duration, error) {
+	var d time.Duration
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, err
+		}
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %q", s)
+	}
+	return d, nil
+}
+
+// historyCommand runs the history subcommand given by args. The
+// configured retention supplies the defaults of history prune.
+func historyCommand(args []string, retention historyRetention) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: history export|prune [flags]")
+	}
+	switch args[0] {
+	case "export":
+		exportHistory(args[1:])
+	case "prune":
+		fs := flag.NewFlagSet("history prune", flag.ExitOnError)
+		fs.StringVar(&retention.MaxAge, "max-age", retention.MaxAge,
+			"remove runs older than this age, e.g. 90d")
+		fs.IntVar(&retention.MaxRows, "max-rows", retention.MaxRows,
+			"keep at most this many runs (0 means no limit)")
+		fs.Int64Var(&retention.MaxBytes, "max-bytes", retention.MaxBytes,
+			"keep the history file below this size (0 means no limit)")
+		fs.Parse(args[1:])
+		if !retention.enabled() {
+			log.Fatalf("No retention limit given or configured")
+		}
+		removed, err := pruneHistory(retention)
+		if err != nil {
+			log.Fatalf("Unable to prune history file: %v", err)
+		}
+		fmt.Printf("Removed %d runs from the history\n", removed)
+	default:
+		log.Fatalf("Unknown history command %q", args[0])
+	}
+}
+
+// exportHistory prints the recorded runs selected by args.
+func exportHistory(args []string) {
+	fs := flag.NewFlagSet("history export", flag.ExitOnError)
+	since := fs.String("since", "", "only export runs newer than this age, e.g. 30d or 12h")
+	format := fs.String("format", "json", "output format: csv or json")
+	fs.Parse(args)
+
+	var from time.Time
+	if *since != "" {
+		age, err := parseAge(*since)
+		if err != nil {
+			log.Fatalf("Invalid -since: %v", err)
+		}
+		from = time.Now().Add(-age)
+	}
+	records, err := readHistory(from)
+	if err != nil {
+		log.Fatalf("Unable to read history file: %v", err)
+	}
+
+	switch *format {
+	case "json":
+		if records == nil {
+			records = []historyRecord{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(records)
+	case "csv":
+		err = writeHistoryCSV(records)
+	default:
+		log.Fatalf("Unknown format %q", *format)
+	}
+	if err != nil {
+		log.Fatalf("Unable to export history: %v", err)
+	}
+}
+
+// writeHistoryCSV writes the records to standard output as CSV with a
+// header row.
+func writeHistoryCSV(records []historyRecord) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"timestamp", "name", "script_id", "function",
+		"params_hash", "status", "duration_ms", "error_class"})
+	for _, rec := range records {
+		w.Write([]string{
+			rec.Timestamp.Format(time.RFC3339),
+			rec.Name,
+			rec.ScriptID,
+			rec.Function,
+			rec.ParamsHash,
+			rec.Status,
+			strconv.FormatInt(rec.DurationMs, 10),
+			rec.ErrorClass,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
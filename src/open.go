@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os/exec"
+	"runtime"
+)
+
+// editorURL returns the URL of the script in the Apps Script editor.
+func editorURL(scriptId string) string {
+	return "https://script.google.com/d/" + url.PathEscape(scriptId) + "/edit"
+}
+
+// executionsURL returns the URL of the executions view of the script in
+// the Apps Script dashboard.
+func executionsURL(scriptId string) string {
+	return "https://script.google.com/home/projects/" + url.PathEscape(scriptId) + "/executions"
+}
+
+// openBrowser opens the URL in the default browser.
+func openBrowser(rawurl string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", rawurl)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", rawurl)
+	default:
+		cmd = exec.Command("xdg-open", rawurl)
+	}
+	return cmd.Start()
+}
+
+// openCommand opens the script given by args in the browser.
+func openCommand(args []string, cfg *appConfig, scriptId string) {
+	fs := flag.NewFlagSet("open", flag.ExitOnError)
+	executions := fs.Bool("executions", false,
+		"open the executions view of the dashboard instead of the editor")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		log.Fatalf("Usage: open [-executions] [alias]")
+	}
+
+	id := cfg.resolve(fs.Arg(0), scriptId).ScriptID
+	u := editorURL(id)
+	if *executions {
+		u = executionsURL(id)
+	}
+	fmt.Println(u)
+	if err := openBrowser(u); err != nil {
+		log.Fatalf("Unable to open browser: %v", err)
+	}
+}
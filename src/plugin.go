@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/script/v1"
+)
+
+// pluginPrefix is the prefix of executables on PATH that are picked up
+// as plugins, e.g. gasexec-sink-foo or gasexec-notify-bar.
+const pluginPrefix = "gasexec-"
+
+// pluginKinds are the kinds of plugins that receive run results.
+var pluginKinds = []string{"sink", "notify"}
+
+// runResult is the record of a single execution that is passed to plugins
+// as JSON on their standard input.
+type runResult struct {
+	ScriptID     string                 `json:"scriptId"`
+	Function     string                 `json:"function"`
+	Status       string                 `json:"status"`
+	StartedAt    time.Time              `json:"startedAt"`
+	DurationMs   int64                  `json:"durationMs"`
+	Response     googleapi.RawMessage   `json:"response,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+	ErrorClass   string                 `json:"errorClass,omitempty"`
+	ErrorDetails []googleapi.RawMessage `json:"errorDetails,omitempty"`
+}
+
+// newRunResult builds the record of an execution that started at start
+// and finished with the given response and error.
+func newRunResult(scriptId, function string, start time.Time, resp *script.Operation, err error) *runResult {
+	r := &runResult{
+		ScriptID:   scriptId,
+		Function:   function,
+		StartedAt:  start.UTC(),
+		DurationMs: int64(time.Since(start) / time.Millisecond),
+	}
+	switch {
+	case err != nil:
+		// The API encountered a problem before the script started executing.
+		r.Status = "api_error"
+		r.Error = err.Error()
+		r.ErrorClass = apiErrorClass(err)
+	case resp.Error != nil:
+		r.Status = "script_error"
+		r.Error = resp.Error.Message
+		r.ErrorDetails = resp.Error.Details
+		r.ErrorClass = scriptErrorClass(resp.Error)
+	default:
+		r.Status = "ok"
+		r.Response = resp.Response
+	}
+	return r
+}
+
+// apiErrorClass classifies an error returned by the API call.
+func apiErrorClass(err error) string {
+	if gerr, ok := err.(*googleapi.Error); ok {
+		return fmt.Sprintf("http_%d", gerr.Code)
+	}
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		return "timeout"
+	}
+	return "transport"
+}
+
+// scriptErrorClass returns the errorType of the script's error details,
+// e.g. "ReferenceError", falling back to the status message.
+func scriptErrorClass(status *script.Status) string {
+	if len(status.Details) > 0 {
+		var detail struct {
+			ErrorType string `json:"errorType"`
+		}
+		if json.Unmarshal(status.Details[0], &detail) == nil && detail.ErrorType != "" {
+			return detail.ErrorType
+		}
+	}
+	return status.Message
+}
+
+// pluginList is a flag.Value collecting plugin names given more than once
+// or separated by commas.
+type pluginList []string
+
+func (l *pluginList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *pluginList) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			*l = append(*l, name)
+		}
+	}
+	return nil
+}
+
+// runPlugins feeds the result to each named plugin of the given kind.
+// Plugin failures are logged and do not affect the exit status.
+func runPlugins(kind string, names []string, result *runResult) {
+	if len(names) == 0 {
+		return
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("Unable to encode run result for %s plugins: %v", kind, err)
+		return
+	}
+	for _, name := range names {
+		if err := runPlugin(pluginPrefix+kind+"-"+name, b); err != nil {
+			log.Printf("Plugin %s-%s failed: %v", kind, name, err)
+		}
+	}
+}
+
+// runPlugin looks up the executable on PATH and runs it with input on
+// its standard input. Its output goes to standard error so that standard
+// output only carries the script result.
+func runPlugin(executable string, input []byte) error {
+	path, err := exec.LookPath(executable)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// listPlugins prints the plugins found on PATH, one per line.
+func listPlugins() {
+	seen := map[string]bool{}
+	var found []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			name := f.Name()
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			} else if f.IsDir() || f.Mode()&0111 == 0 {
+				continue
+			}
+			if !isPluginName(name) || seen[name] {
+				continue
+			}
+			seen[name] = true
+			found = append(found, fmt.Sprintf("%s\t%s", name, filepath.Join(dir, f.Name())))
+		}
+	}
+	sort.Strings(found)
+	for _, line := range found {
+		fmt.Println(line)
+	}
+}
+
+// isPluginName reports whether name is a plugin executable name.
+func isPluginName(name string) bool {
+	for _, kind := range pluginKinds {
+		prefix := pluginPrefix + kind + "-"
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
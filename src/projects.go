@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// driveFile is a file returned by the Drive API files.list.
+type driveFile struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	ModifiedTime time.Time `json:"modifiedTime"`
+}
+
+// listScriptFiles queries Drive for the Apps Script projects the user can
+// access, most recently modified first. If name is not empty, only
+// projects whose name contains it are returned.
+func listScriptFiles(client *http.Client, name string) ([]driveFile, error) {
+	q := "mimeType = 'application/vnd.google-apps.script' and trashed = false"
+	if name != "" {
+		q += " and name contains '" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(name) + "'"
+	}
+	params := url.Values{}
+	params.Set("q", q)
+	params.Set("fields", "nextPageToken,files(id,name,modifiedTime)")
+	params.Set("orderBy", "modifiedTime desc")
+	params.Set("pageSize", "100")
+
+	var files []driveFile
+	for {
+		resp, err := client.Get("https://www.googleapis.com/drive/v3/files?" + params.Encode())
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			NextPageToken string      `json:"nextPageToken"`
+			Files         []driveFile `json:"files"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			b, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("files.list: %s: %s", resp.Status, strings.TrimSpace(string(b)))
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, page.Files...)
+		if page.NextPageToken == "" {
+			return files, nil
+		}
+		params.Set("pageToken", page.NextPageToken)
+	}
+}
+
+// projectsCommand runs the projects subcommand given by args.
+func projectsCommand(args []string, opts httpOptions, profile string) {
+	if len(args) == 0 || args[0] != "list" {
+		log.Fatalf("Usage: projects list [-name TEXT]")
+	}
+	fs := flag.NewFlagSet("projects list", flag.ExitOnError)
+	name := fs.String("name", "", "only list projects whose name contains TEXT")
+	fs.Parse(args[1:])
+
+	client := getClient(context.Background(), oauthConfig(), newHTTPClient(opts), profile)
+	files, err := listScriptFiles(client, *name)
+	if err != nil {
+		log.Fatalf("Unable to list script projects: %v", err)
+	}
+	if len(files) == 0 {
+		fmt.Println("No script projects found.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSCRIPT ID\tLAST MODIFIED")
+	for _, f := range files {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", f.Name, f.ID, f.ModifiedTime.Local().Format("2006-01-02 15:04"))
+	}
+	w.Flush()
+}
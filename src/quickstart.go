@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -10,6 +11,7 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"time"
 
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
@@ -17,26 +19,39 @@ import (
 	"google.golang.org/api/script/v1"
 )
 
-// getClient uses a Context and Config to retrieve a Token
-// then generate a Client. It returns the generated Client.
-func getClient(ctx context.Context, config *oauth2.Config) *http.Client {
-	cacheFile, err := tokenCacheFile()
+// scopes are requested when authorizing a profile.
+// If modifying these scopes, delete your previously saved credentials
+// at ~/.credentials/script-go-quickstart*.json
+var scopes = []string{
+	"https://www.googleapis.com/auth/drive",
+	"https://www.googleapis.com/auth/userinfo.email",
+}
+
+// getClient uses a Context and Config to retrieve the Token of the
+// profile then generate a Client. It returns the generated Client.
+// Requests, including token refreshes, go through base.
+func getClient(ctx context.Context, config *oauth2.Config, base *http.Client, profile string) *http.Client {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, base)
+	cacheFile, err := tokenCacheFile(profile)
 	if err != nil {
 		log.Fatalf("Unable to get path to cached credential file. %v", err)
 	}
 	tok, err := tokenFromFile(cacheFile)
 	if err != nil {
-		tok = getTokenFromWeb(config)
+		tok = getTokenFromWeb(ctx, config)
 		saveToken(cacheFile, tok)
 	}
-	return config.Client(ctx, tok)
+	client := config.Client(ctx, tok)
+	client.Timeout = base.Timeout
+	return client
 }
 
-// getTokenFromWeb uses Config to request a Token.
-// It returns the retrieved Token.
-func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
-	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Printf("Go to the following link in your browser then type the "+
+// getTokenFromWeb uses Config to request a Token, adding any opts to
+// the authorization URL. It returns the retrieved Token.
+func getTokenFromWeb(ctx context.Context, config *oauth2.Config, opts ...oauth2.AuthCodeOption) *oauth2.Token {
+	authURL := config.AuthCodeURL("state-token",
+		append([]oauth2.AuthCodeOption{oauth2.AccessTypeOffline}, opts...)...)
+	fmt.Fprintf(os.Stderr, "Go to the following link in your browser then type the "+
 		"authorization code: \n%v\n", authURL)
 
 	var code string
@@ -44,24 +59,33 @@ func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
 		log.Fatalf("Unable to read authorization code %v", err)
 	}
 
-	tok, err := config.Exchange(oauth2.NoContext, code)
+	tok, err := config.Exchange(ctx, code)
 	if err != nil {
 		log.Fatalf("Unable to retrieve token from web %v", err)
 	}
 	return tok
 }
 
-// tokenCacheFile generates credential file path/filename.
-// It returns the generated credential path/filename.
-func tokenCacheFile() (string, error) {
+// credentialsFile generates the path of a file in the credentials
+// directory. It returns the generated path/filename.
+func credentialsFile(name string) (string, error) {
 	usr, err := user.Current()
 	if err != nil {
 		return "", err
 	}
 	tokenCacheDir := filepath.Join(usr.HomeDir, ".credentials")
 	os.MkdirAll(tokenCacheDir, 0700)
-	return filepath.Join(tokenCacheDir,
-		url.QueryEscape("script-go-quickstart.json")), err
+	return filepath.Join(tokenCacheDir, url.QueryEscape(name)), err
+}
+
+// tokenCacheFile generates credential file path/filename of a profile.
+// The default profile keeps the original file name.
+// It returns the generated credential path/filename.
+func tokenCacheFile(profile string) (string, error) {
+	if profile == defaultProfileName {
+		return credentialsFile("script-go-quickstart.json")
+	}
+	return credentialsFile("script-go-quickstart-" + profile + ".json")
 }
 
 // tokenFromFile retrieves a Token from a given file path.
@@ -80,7 +104,7 @@ func tokenFromFile(file string) (*oauth2.Token, error) {
 // saveToken uses a file path to create a file and store the
 // token in it.
 func saveToken(file string, token *oauth2.Token) {
-	fmt.Printf("Saving credential file to: %s\n", file)
+	fmt.Fprintf(os.Stderr, "Saving credential file to: %s\n", file)
 	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		log.Fatalf("Unable to cache oauth token: %v", err)
@@ -89,38 +113,143 @@ func saveToken(file string, token *oauth2.Token) {
 	json.NewEncoder(f).Encode(token)
 }
 
-func main() {
-	ctx := context.Background()
-
+// readOAuthConfig reads the client secret file.
+// It returns the OAuth2 config requesting scopes and any error encountered.
+func readOAuthConfig() (*oauth2.Config, error) {
 	b, err := ioutil.ReadFile("client_secret.json")
 	if err != nil {
-		log.Fatalf("Unable to read client secret file: %v", err)
+		return nil, fmt.Errorf("Unable to read client secret file: %v", err)
+	}
+
+	config, err := google.ConfigFromJSON(b, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse client secret file to config: %v", err)
+	}
+	return config, nil
+}
+
+// oauthConfig reads the client secret file.
+// It returns the OAuth2 config requesting scopes.
+func oauthConfig() *oauth2.Config {
+	config, err := readOAuthConfig()
+	if err != nil {
+		log.Fatal(err)
 	}
+	return config
+}
 
-	// If modifying these scopes, delete your previously saved credentials
-	// at ~/.credentials/script-go-quickstart.json
-	config, err := google.ConfigFromJSON(b, "https://www.googleapis.com/auth/drive")
+// getCachedClient is like getClient, but returns an error instead of
+// asking the user to authorize when the profile has no usable token.
+func getCachedClient(ctx context.Context, config *oauth2.Config, base *http.Client, profile string) (*http.Client, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, base)
+	cacheFile, err := tokenCacheFile(profile)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get path to cached credential file. %v", err)
+	}
+	tok, err := tokenFromFile(cacheFile)
 	if err != nil {
-		log.Fatalf("Unable to parse client secret file to config: %v", err)
+		return nil, fmt.Errorf("No usable credential for profile %s: %v", profile, err)
 	}
-	scriptId := "Mn_YoQoNj_iufS59FmWsY-JgYYRqhh78z"
-	client := getClient(ctx, config)
+	client := config.Client(ctx, tok)
+	client.Timeout = base.Timeout
+	return client, nil
+}
+
+// newCachedService returns a script service object for the profile
+// without asking the user to authorize. It returns any error encountered.
+func newCachedService(ctx context.Context, opts httpOptions, profile string) (*script.Service, error) {
+	config, err := readOAuthConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := getCachedClient(ctx, config, newHTTPClient(opts), profile)
+	if err != nil {
+		return nil, err
+	}
+	return script.New(client)
+}
+
+// newService authorizes the user of the profile and returns a script
+// service object.
+func newService(ctx context.Context, opts httpOptions, profile string) *script.Service {
+	client := getClient(ctx, oauthConfig(), newHTTPClient(opts), profile)
 
 	// Generate a service object.
 	srv, err := script.New(client)
 	if err != nil {
 		log.Fatalf("Unable to retrieve script Client %v", err)
 	}
+	return srv
+}
+
+// runOptions controls what is done with the result of an execution
+// besides printing it.
+type runOptions struct {
+	Sinks     pluginList
+	Notifiers pluginList
+	History   bool
+	Retention historyRetention
+	Raw       bool
+}
 
+// execute runs the target function within ctx and hands the result to
+// plugins and the history. It returns the response, or the error of a
+// call that did not reach the script. archiveErr is set when the call
+// completed but could not be archived.
+func execute(ctx context.Context, srv *script.Service, t *target, ropts *runOptions) (resp *script.Operation, archiveErr, err error) {
 	// Create an execution request object.
-	req := script.ExecutionRequest{Function: "getFoldersUnderRoot"}
+	req := script.ExecutionRequest{
+		Function:   t.Function,
+		Parameters: t.Parameters,
+		DevMode:    t.DevMode,
+	}
 
 	// Make the API request.
-	resp, err := srv.Scripts.Run(scriptId, &req).Do()
+	status := &archiveStatus{}
+	ctx = context.WithValue(ctx, archiveStatusKey{}, status)
+	start := time.Now()
+	resp, err = srv.Scripts.Run(t.runID(), &req).Context(ctx).Do()
+	result := newRunResult(t.ScriptID, req.Function, start, resp, err)
+	runPlugins("sink", ropts.Sinks, result)
+	runPlugins("notify", ropts.Notifiers, result)
+	if ropts.History {
+		recordHistory(t, result, ropts.Retention)
+	}
+	return resp, status.err, err
+}
+
+// runScript executes the target function as the profile and prints its
+// result. If the execution fails for lack of scopes, the user is offered
+// to authorize the missing ones and the execution is retried once.
+func runScript(opts httpOptions, profile string, t *target, ropts *runOptions) {
+	ctx := context.Background()
+	resp, archiveErr, err := execute(ctx, newService(ctx, opts, profile), t, ropts)
+	if scopeFailure(resp, err) && recoverScopes(opts, profile, t.ScriptID, resp, err) {
+		var retryArchiveErr error
+		resp, retryArchiveErr, err = execute(ctx, newService(ctx, opts, profile), t, ropts)
+		if archiveErr == nil {
+			archiveErr = retryArchiveErr
+		}
+	}
+	if archiveErr != nil {
+		// The execution itself finished; report the missing record and
+		// exit with an error once its result has been handled.
+		log.Printf("Unable to archive execution: %v", archiveErr)
+		defer os.Exit(1)
+	}
 	if err != nil {
 		// The API encountered a problem before the script started executing.
 		log.Fatalf("Unable to execute Apps Script function. %v", err)
 	}
+	if resp.Error == nil {
+		if err := validateResult(t, resp.Response); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if ropts.Raw {
+		printRaw(resp)
+		return
+	}
 
 	if resp.Error != nil {
 		fmt.Printf("%s", resp.Error)
@@ -159,5 +288,168 @@ func main() {
 		//	}
 		//}
 	}
+}
+
+// flagSet reports whether the named flag was given on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func main() {
+	var opts httpOptions
+	flag.DurationVar(&opts.DialTimeout, "dial-timeout", 30*time.Second,
+		"maximum time to establish a TCP connection")
+	flag.DurationVar(&opts.TLSHandshakeTimeout, "tls-handshake-timeout", 10*time.Second,
+		"maximum time to complete the TLS handshake")
+	flag.DurationVar(&opts.ResponseHeaderTimeout, "response-header-timeout", 0,
+		"maximum time to wait for response headers; includes script execution time (0 disables)")
+	flag.DurationVar(&opts.Timeout, "timeout", 0,
+		"maximum time for the whole request, including reading the body (0 disables)")
+	flag.BoolVar(&opts.HTTP1, "http1", false,
+		"force HTTP/1.1 instead of negotiating HTTP/2")
+	flag.BoolVar(&opts.Gzip, "gzip", true,
+		"accept gzip-compressed responses")
+	flag.IntVar(&opts.MaxConnsPerHost, "max-conns-per-host", 0,
+		"maximum number of connections per host (0 means no limit)")
+	flag.StringVar(&opts.ArchiveDir, "archive", "",
+		"write the exact request and response of every execution to this directory")
+	var ropts runOptions
+	flag.Var(&ropts.Sinks, "sink",
+		"send the run result to the "+pluginPrefix+"sink-NAME plugin (repeatable)")
+	flag.Var(&ropts.Notifiers, "notify",
+		"send the run result to the "+pluginPrefix+"notify-NAME plugin (repeatable)")
+	configFile := flag.String("config", defaultConfigFile,
+		"path to the configuration file")
+	scriptId := flag.String("script", defaultScriptID,
+		"script ID used for functions that are not aliases")
+	flag.BoolVar(&ropts.History, "history", true,
+		"record the run in the history file")
+	flag.DurationVar(&metadataCacheTTL, "cache-ttl", metadataCacheTTL,
+		"use cached project metadata this long before revalidating it (0 always revalidates)")
+	env := flag.String("env", "",
+		"environment of the config file to use, e.g. prod")
+	profile := flag.String("profile", "",
+		"credential profile to use instead of the default one")
+	flag.Parse()
+	if *profile == "" {
+		*profile = defaultProfile()
+	} else if err := checkProfileName(*profile); err != nil {
+		log.Fatalf("Invalid -profile: %v", err)
+	}
+
+	switch flag.Arg(0) {
+	case "plugins":
+		listPlugins()
+		return
+	case "config":
+		if flag.Arg(1) != "validate" {
+			log.Fatalf("Usage: config validate")
+		}
+		if !validateConfig(*configFile) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Unable to load config file: %v", err)
+	}
+	cfg, envScript, err := cfg.forEnvironment(*env)
+	if err != nil {
+		log.Fatalf("Invalid -env: %v", err)
+	}
+	if envScript != "" && !flagSet("script") {
+		*scriptId = envScript
+	}
+	if opts.ArchiveDir == "" {
+		opts.ArchiveDir = cfg.Archive.Dir
+	}
+	if err := cfg.Profiles[*profile].apply(&opts); err != nil {
+		log.Fatalf("Invalid settings of profile %s: %v", *profile, err)
+	}
+	ropts.Retention = cfg.History
+	name := defaultFunction
+	switch flag.Arg(0) {
+	case "doctor":
+		doctor(opts, *profile)
+		return
+	case "accounts":
+		accountsCommand(flag.Args()[1:], opts)
+		return
+	case "whoami":
+		whoami(opts, *profile)
+		return
+	case "projects":
+		projectsCommand(flag.Args()[1:], opts, *profile)
+		return
+	case "history":
+		historyCommand(flag.Args()[1:], cfg.History)
+		return
+	case "archive":
+		fs := flag.NewFlagSet("archive verify", flag.ExitOnError)
+		head := fs.String("head", "", "hash printed by an earlier verify that must still be in the archive")
+		if flag.Arg(1) == "verify" {
+			fs.Parse(flag.Args()[2:])
+		}
+		if flag.Arg(1) != "verify" || fs.NArg() > 0 {
+			log.Fatalf("Usage: archive verify [-head hash]")
+		}
+		if opts.ArchiveDir == "" {
+			log.Fatalf("No archive directory given with -archive or configured")
+		}
+		if !verifyArchive(opts.ArchiveDir, *head) {
+			os.Exit(1)
+		}
+		return
+	case "scopes":
+		fs := flag.NewFlagSet("scopes", flag.ExitOnError)
+		check := fs.Bool("check", false, "only report missing scopes and exit with status 1")
+		fs.Parse(flag.Args()[1:])
+		if fs.NArg() > 1 {
+			log.Fatalf("Usage: scopes [-check] [alias]")
+		}
+		scopesCommand(opts, *profile, cfg.resolve(fs.Arg(0), *scriptId).ScriptID, *check)
+		return
+	case "functions":
+		if flag.NArg() > 2 {
+			log.Fatalf("Usage: functions [alias]")
+		}
+		listFunctions(opts, *profile, cfg.resolve(flag.Arg(1), *scriptId).ScriptID)
+		return
+	case "open":
+		openCommand(flag.Args()[1:], cfg, *scriptId)
+		return
+	case "terraform":
+		if flag.NArg() != 2 {
+			log.Fatalf("Usage: terraform <alias|function>")
+		}
+		terraformDataSource(opts, *profile, cfg.resolve(flag.Arg(1), *scriptId), &ropts)
+		return
+	case "check":
+		if flag.NArg() != 2 {
+			log.Fatalf("Usage: check <name>")
+		}
+		os.Exit(runCheck(opts, *profile, cfg, flag.Arg(1), &ropts))
+	case "":
+	case "run":
+		fs := flag.NewFlagSet("run", flag.ExitOnError)
+		fs.BoolVar(&ropts.Raw, "raw", false,
+			"print only the bare result value; strings are printed unquoted")
+		args := parseInterspersed(fs, flag.Args()[1:])
+		if len(args) != 1 {
+			log.Fatalf("Usage: run [-raw] <alias|function>")
+		}
+		name = args[0]
+	default:
+		log.Fatalf("Unknown command %q", flag.Arg(0))
+	}
 
+	runScript(opts, *profile, cfg.resolve(name, *scriptId), &ropts)
 }
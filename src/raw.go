@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/script/v1"
+)
+
+// parseInterspersed parses the flags of fs that may appear before, between
+// or after the positional arguments, so that "run fn -raw" works as well
+// as "run -raw fn". It returns the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// rawResult extracts the result value of an execution response. Strings
+// are returned unquoted and other values as compact JSON.
+func rawResult(response googleapi.RawMessage) ([]byte, error) {
+	var r struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(response, &r); err != nil {
+		return nil, err
+	}
+	if len(r.Result) == 0 {
+		// Functions that return nothing have no result field.
+		return nil, nil
+	}
+	if string(r.Result) == "null" {
+		// null would unmarshal into an empty string.
+		return r.Result, nil
+	}
+	var s string
+	if json.Unmarshal(r.Result, &s) == nil {
+		return []byte(s), nil
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, r.Result); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scriptErrorMessage returns the errorMessage of the script's error
+// details, falling back to the status message.
+func scriptErrorMessage(status *script.Status) string {
+	if len(status.Details) > 0 {
+		var detail struct {
+			ErrorMessage string `json:"errorMessage"`
+		}
+		if json.Unmarshal(status.Details[0], &detail) == nil && detail.ErrorMessage != "" {
+			return detail.ErrorMessage
+		}
+	}
+	return status.Message
+}
+
+// printRaw prints only the bare result of the execution, followed by a
+// newline. A script error is printed to standard error and the program
+// exits with status 1.
+func printRaw(resp *script.Operation) {
+	if resp.Error != nil {
+		fmt.Fprintln(os.Stderr, scriptErrorMessage(resp.Error))
+		os.Exit(1)
+	}
+	b, err := rawResult(resp.Response)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to decode result: %v\n", err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(append(b, '\n'))
+}
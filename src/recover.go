@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/script/v1"
+)
+
+// scopeFailure reports whether an execution failed because the token
+// lacks scopes: either the API refused the call, or the script stopped
+// because it needs an authorization that was not granted.
+func scopeFailure(resp *script.Operation, err error) bool {
+	if gerr, ok := err.(*googleapi.Error); ok {
+		return gerr.Code == 403 && (isScopeError(gerr.Message) || isScopeError(gerr.Body))
+	}
+	if err != nil || resp.Error == nil {
+		return false
+	}
+	msg := scriptErrorMessage(resp.Error)
+	return strings.Contains(msg, "Authorization is required") ||
+		strings.Contains(msg, "You do not have permission to call") ||
+		strings.Contains(msg, "ACCESS_DENIED")
+}
+
+// scopeURL matches the OAuth scopes listed in error messages, such as
+// "Required permissions: https://www.googleapis.com/auth/spreadsheets".
+var scopeURL = regexp.MustCompile(`https://(www\.googleapis\.com/auth/[\w./-]*\w|mail\.google\.com/|www\.google\.com/m8/feeds)`)
+
+// errorScopes returns the scopes named by the error of a failed
+// execution, in the order they appear, or nil if it names none.
+func errorScopes(resp *script.Operation, err error) []string {
+	var text string
+	if gerr, ok := err.(*googleapi.Error); ok {
+		text = gerr.Message + "\n" + gerr.Body
+	} else if err == nil && resp != nil && resp.Error != nil {
+		text = scriptErrorMessage(resp.Error)
+	}
+	var scopes []string
+	seen := map[string]bool{}
+	for _, s := range scopeURL.FindAllString(text, -1) {
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// interactive reports whether standard input is a terminal, so that the
+// user can be asked before starting an authorization flow.
+func interactive() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// recoverScopes finds the scopes the failed execution needs that the
+// profile's token lacks and, if the user agrees, authorizes just those.
+// The scopes are taken from the error of the execution, or from the
+// script's manifest when the error names none. The user is asked before
+// every authorization, including the one needed to read the manifest.
+// It returns whether new scopes were granted and the call can be
+// retried; on any other outcome the caller reports the original error.
+func recoverScopes(opts httpOptions, profile, scriptId string, resp *script.Operation, execErr error) bool {
+	if !interactive() {
+		fmt.Fprintf(os.Stderr, "The token of profile %s lacks scopes the script needs; "+
+			"run the scopes command to authorize them.\n", profile)
+		return false
+	}
+	ctx := context.Background()
+	config, err := readOAuthConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return false
+	}
+	base := newHTTPClient(opts)
+	in := bufio.NewReader(os.Stdin)
+	ask := func(question string) bool {
+		fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+		answer, _ := in.ReadString('\n')
+		a := strings.ToLower(strings.TrimSpace(answer))
+		return a == "y" || a == "yes"
+	}
+
+	required := errorScopes(resp, execErr)
+	if required == nil {
+		required, err = requiredScopes(ctx, config, base, profile, scriptId, func(add []string) bool {
+			return ask(fmt.Sprintf("Reading the script's manifest to find the missing scopes needs:\n\t%s\n"+
+				"Authorize it now?", strings.Join(add, "\n\t")))
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to determine the missing scopes: %v\n", err)
+			return false
+		}
+		if required == nil {
+			fmt.Fprintf(os.Stderr, "Neither the error nor the script's manifest lists the "+
+				"missing scopes. Add oauthScopes to appsscript.json.\n")
+			return false
+		}
+	}
+	tok, err := profileToken(ctx, config, base, profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to read token of profile %s: %v\n", profile, err)
+		return false
+	}
+	info, err := fetchTokenInfo(base, tok.AccessToken)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to inspect token: %v\n", err)
+		return false
+	}
+	missing := missingScopes(required, info.scopes())
+	if len(missing) == 0 {
+		fmt.Fprintf(os.Stderr, "The token already has every scope the script needs; "+
+			"check that the account may run the script.\n")
+		return false
+	}
+
+	if !ask(fmt.Sprintf("The script needs scopes that profile %s has not granted:\n\t%s\n"+
+		"Authorize them now and retry?", profile, strings.Join(missing, "\n\t"))) {
+		return false
+	}
+	reauthorize(ctx, config, base, profile, missing)
+	return true
+}
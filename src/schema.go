@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// validateResult checks the result of an execution response against the
+// result schema of the target. It returns nil if the target has none.
+func validateResult(t *target, response []byte) error {
+	if t.ResultSchema == nil {
+		return nil
+	}
+	var r struct {
+		Result interface{} `json:"result"`
+	}
+	if err := json.Unmarshal(response, &r); err != nil {
+		return err
+	}
+	problems := checkSchema(r.Result, t.ResultSchema, "result")
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("result does not match the schema of %s:\n\t%s", t.Name, strings.Join(problems, "\n\t"))
+}
+
+// checkSchema validates value against a JSON Schema and returns one
+// message per problem. Only the type, enum, properties, required,
+// additionalProperties and items keywords are supported; others are
+// ignored.
+func checkSchema(value interface{}, schema map[string]interface{}, path string) []string {
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		actual := jsonType(value)
+		ok := false
+		for _, t := range types {
+			if t == actual || t == "number" && actual == "integer" {
+				ok = true
+			}
+		}
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected %s, found %s", path, strings.Join(types, " or "), actual)}
+		}
+	}
+
+	var problems []string
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+			}
+		}
+		if !found {
+			b, _ := json.Marshal(value)
+			problems = append(problems, fmt.Sprintf("%s: %s is not one of the allowed values", path, b))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, r := range required {
+				if key, ok := r.(string); ok {
+					if _, present := v[key]; !present {
+						problems = append(problems, fmt.Sprintf("%s: missing property %q", path, key))
+					}
+				}
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if sub, ok := properties[key].(map[string]interface{}); ok {
+				problems = append(problems, checkSchema(v[key], sub, path+"."+key)...)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					problems = append(problems, fmt.Sprintf("%s: unexpected property %q", path, key))
+				}
+			case map[string]interface{}:
+				problems = append(problems, checkSchema(v[key], extra, path+"."+key)...)
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				problems = append(problems, checkSchema(item, items, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+	return problems
+}
+
+// schemaTypes returns the type keyword of a schema as a list.
+func schemaTypes(t interface{}) []string {
+	switch t := t.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var types []string
+		for _, s := range t {
+			if s, ok := s.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// jsonType returns the JSON Schema type name of a decoded JSON value.
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+// projectsReadonlyScope is needed to read a project's manifest.
+const projectsReadonlyScope = "https://www.googleapis.com/auth/script.projects.readonly"
+
+// projectContent is the response of the Apps Script API projects.getContent.
+type projectContent struct {
+	ScriptID string        `json:"scriptId"`
+	Files    []projectFile `json:"files"`
+}
+
+// projectFile is a file of a script project.
+type projectFile struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Source      string `json:"source"`
+	FunctionSet struct {
+		Values []struct {
+			Name string `json:"name"`
+		} `json:"values"`
+	} `json:"functionSet"`
+}
+
+// scriptManifest holds the parts of appsscript.json used here.
+type scriptManifest struct {
+	OAuthScopes []string `json:"oauthScopes"`
+}
+
+// errNeedsProjectsScope is returned when the token may not read projects.
+var errNeedsProjectsScope = fmt.Errorf("reading the project needs the %s scope", projectsReadonlyScope)
+
+// fetchProjectContent retrieves the files of a script project through
+// the metadata cache of the profile.
+func fetchProjectContent(client *http.Client, profile, scriptId string) (*projectContent, error) {
+	b, err := cachedGet(client, profile,
+		"https://script.googleapis.com/v1/projects/"+url.PathEscape(scriptId)+"/content")
+	if herr, ok := err.(*httpError); ok {
+		if herr.StatusCode == http.StatusForbidden && isScopeError(herr.Body) {
+			return nil, errNeedsProjectsScope
+		}
+		return nil, fmt.Errorf("projects.getContent: %v", herr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	content := &projectContent{}
+	if err := json.Unmarshal(b, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// functions returns the names of the functions defined in the project,
+// in the order of its files.
+func (c *projectContent) functions() []string {
+	var names []string
+	for _, f := range c.Files {
+		for _, fn := range f.FunctionSet.Values {
+			names = append(names, fn.Name)
+		}
+	}
+	return names
+}
+
+// isScopeError reports whether an error message returned by a Google API
+// says the token lacks a scope.
+func isScopeError(message string) bool {
+	return strings.Contains(message, "ACCESS_TOKEN_SCOPE_INSUFFICIENT") ||
+		strings.Contains(message, "insufficient authentication scopes") ||
+		strings.Contains(message, "insufficientPermissions")
+}
+
+// manifest parses the appsscript.json file of the project.
+func (c *projectContent) manifest() (*scriptManifest, error) {
+	for _, f := range c.Files {
+		if f.Name == "appsscript" && f.Type == "JSON" {
+			m := &scriptManifest{}
+			if err := json.Unmarshal([]byte(f.Source), m); err != nil {
+				return nil, fmt.Errorf("appsscript.json: %v", err)
+			}
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("the project has no appsscript.json")
+}
+
+// missingScopes returns the required scopes that are not granted, sorted.
+func missingScopes(required, granted []string) []string {
+	have := map[string]bool{}
+	for _, s := range granted {
+		have[s] = true
+	}
+	var missing []string
+	for _, s := range required {
+		if !have[s] {
+			missing = append(missing, s)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// reauthorize runs the OAuth flow again for just the given scopes and
+// saves the token of the profile. Previously granted scopes are kept by
+// asking Google to include them in the new token, and the previous
+// refresh token is kept if the exchange returns none.
+func reauthorize(ctx context.Context, config *oauth2.Config, base *http.Client, profile string, add []string) {
+	file, err := tokenCacheFile(profile)
+	if err != nil {
+		log.Fatalf("Unable to get path to cached credential file. %v", err)
+	}
+	incremental := *config
+	incremental.Scopes = add
+	fmt.Fprintf(os.Stderr, "Requesting additional scopes:\n\t%s\n", strings.Join(add, "\n\t"))
+	tok := getTokenFromWeb(context.WithValue(ctx, oauth2.HTTPClient, base), &incremental,
+		oauth2.SetAuthURLParam("include_granted_scopes", "true"))
+	if tok.RefreshToken == "" {
+		if old, err := tokenFromFile(file); err == nil {
+			tok.RefreshToken = old.RefreshToken
+		}
+	}
+	saveToken(file, tok)
+}
+
+// projectContentFor retrieves the files of a script project. If the
+// token lacks the scope that reads projects, that scope is authorized and
+// the request retried. With a nil confirm this happens without asking and
+// a missing token is authorized too; otherwise only a cached token is
+// used and confirm is asked first, errNeedsProjectsScope being returned
+// if it declines.
+func projectContentFor(ctx context.Context, config *oauth2.Config, base *http.Client, profile, scriptId string,
+	confirm func(add []string) bool) (*projectContent, error) {
+	client := func() (*http.Client, error) {
+		if confirm == nil {
+			return getClient(ctx, config, base, profile), nil
+		}
+		return getCachedClient(ctx, config, base, profile)
+	}
+	c, err := client()
+	if err != nil {
+		return nil, err
+	}
+	content, err := fetchProjectContent(c, profile, scriptId)
+	if err != errNeedsProjectsScope {
+		return content, err
+	}
+	add := []string{projectsReadonlyScope}
+	if confirm != nil && !confirm(add) {
+		return nil, err
+	}
+	reauthorize(ctx, config, base, profile, add)
+	if c, err = client(); err != nil {
+		return nil, err
+	}
+	return fetchProjectContent(c, profile, scriptId)
+}
+
+// listFunctions prints the functions defined in the script, one per line.
+func listFunctions(opts httpOptions, profile, scriptId string) {
+	content, err := projectContentFor(context.Background(), oauthConfig(), newHTTPClient(opts), profile, scriptId, nil)
+	if err != nil {
+		log.Fatalf("Unable to read script project: %v", err)
+	}
+	for _, name := range content.functions() {
+		fmt.Println(name)
+	}
+}
+
+// requiredScopes returns the scopes the manifest of the script declares,
+// reading the project as projectContentFor does. It returns nil scopes if
+// the manifest leaves them to be detected automatically, and any error
+// encountered.
+func requiredScopes(ctx context.Context, config *oauth2.Config, base *http.Client, profile, scriptId string,
+	confirm func(add []string) bool) ([]string, error) {
+	content, err := projectContentFor(ctx, config, base, profile, scriptId, confirm)
+	if err != nil {
+		return nil, fmt.Errorf("script project: %v", err)
+	}
+	m, err := content.manifest()
+	if err != nil {
+		return nil, fmt.Errorf("script manifest: %v", err)
+	}
+	return m.OAuthScopes, nil
+}
+
+// scopesCommand compares the scopes granted to the profile's token with
+// the scopes required by the script and, unless check is set, asks for
+// the missing ones. With check set it exits with status 1 instead, and
+// never starts an authorization: only a cached token is used, and a
+// token that cannot read the manifest is reported as an error.
+func scopesCommand(opts httpOptions, profile, scriptId string, check bool) {
+	ctx := context.Background()
+	config := oauthConfig()
+	base := newHTTPClient(opts)
+
+	var confirm func(add []string) bool
+	if check {
+		confirm = func([]string) bool { return false }
+	}
+	required, err := requiredScopes(ctx, config, base, profile, scriptId, confirm)
+	if err != nil {
+		log.Fatalf("Unable to read script manifest: %v", err)
+	}
+	if required == nil {
+		fmt.Println("The manifest does not list oauthScopes; Apps Script detects them automatically.")
+		return
+	}
+	tok, err := profileToken(ctx, config, base, profile)
+	if err != nil {
+		log.Fatalf("Unable to read token of profile %s: %v", profile, err)
+	}
+	info, err := fetchTokenInfo(base, tok.AccessToken)
+	if err != nil {
+		log.Fatalf("Unable to inspect token: %v", err)
+	}
+
+	missing := missingScopes(required, info.scopes())
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "SCOPE\tGRANTED")
+	sorted := append([]string(nil), required...)
+	sort.Strings(sorted)
+	for _, s := range sorted {
+		granted := "yes"
+		if i := sort.SearchStrings(missing, s); i < len(missing) && missing[i] == s {
+			granted = "no"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", s, granted)
+	}
+	w.Flush()
+
+	if len(missing) == 0 {
+		return
+	}
+	if check {
+		os.Exit(1)
+	}
+	reauthorize(ctx, config, base, profile, missing)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"golang.org/x/net/context"
+)
+
+// terraformDataSource implements Terraform's external data source
+// protocol: the query, a JSON object of strings, is read from standard
+// input and appended to the target's parameters, and the result is
+// written to standard output as a JSON object of strings. Errors go to
+// standard error with a non-zero exit status, as Terraform expects.
+// Terraform gives no terminal, so only a cached token is used.
+func terraformDataSource(opts httpOptions, profile string, t *target, ropts *runOptions) {
+	var query map[string]string
+	if err := json.NewDecoder(os.Stdin).Decode(&query); err != nil {
+		terraformFail("Unable to read query from stdin: %v", err)
+	}
+	if len(query) > 0 {
+		t.Parameters = append(append([]interface{}(nil), t.Parameters...), query)
+	}
+
+	ctx := context.Background()
+	srv, err := newCachedService(ctx, opts, profile)
+	if err != nil {
+		terraformFail("Unable to authorize profile %s: %v", profile, err)
+	}
+	resp, archiveErr, err := execute(ctx, srv, t, ropts)
+	if err != nil {
+		terraformFail("Unable to execute Apps Script function. %v", err)
+	}
+	if archiveErr != nil {
+		terraformFail("The function ran but could not be archived: %v", archiveErr)
+	}
+	if resp.Error != nil {
+		terraformFail("%s: %s", t.Function, scriptErrorMessage(resp.Error))
+	}
+	if err := validateResult(t, resp.Response); err != nil {
+		terraformFail("%v", err)
+	}
+	var r struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(resp.Response, &r); err != nil {
+		terraformFail("Unable to decode result: %v", err)
+	}
+	out, err := terraformOutputs(r.Result)
+	if err != nil {
+		terraformFail("Unable to convert result: %v", err)
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(out); err != nil {
+		terraformFail("Unable to write result: %v", err)
+	}
+}
+
+// terraformOutputs converts a function result to the flat string map
+// Terraform accepts. The values of an object are kept as they are when
+// they are strings and JSON encoded otherwise; any other result is
+// returned under the "result" key.
+func terraformOutputs(result json.RawMessage) (map[string]string, error) {
+	out := map[string]string{}
+	if len(result) == 0 {
+		return out, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(result, &fields); err != nil {
+		fields = map[string]json.RawMessage{"result": result}
+	}
+	for k, v := range fields {
+		var s string
+		if json.Unmarshal(v, &s) == nil {
+			out[k] = s
+			continue
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = string(b)
+	}
+	return out, nil
+}
+
+// terraformFail prints the message to standard error and exits.
+func terraformFail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
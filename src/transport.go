@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// httpOptions holds the settings of the HTTP client that talks to the
+// Apps Script API. A zero timeout disables the corresponding timeout and
+// a zero MaxConnsPerHost means no limit. If ArchiveDir is set, every
+// scripts.run call is archived there.
+type httpOptions struct {
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	Timeout               time.Duration
+	HTTP1                 bool
+	Gzip                  bool
+	MaxConnsPerHost       int
+	ArchiveDir            string
+}
+
+// newHTTPClient builds an HTTP client from the given options.
+// scripts.run does not answer until the function has finished, so the
+// response-header and overall timeouts bound the script execution time
+// as well as the network round trip.
+func newHTTPClient(opts httpOptions) *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   opts.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          100,
+		ExpectContinueTimeout: 1 * time.Second,
+		ForceAttemptHTTP2:     !opts.HTTP1,
+		DisableCompression:    !opts.Gzip,
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+	}
+	if opts.HTTP1 {
+		// A non-nil, empty map keeps the transport from upgrading to HTTP/2.
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	if opts.ArchiveDir != "" {
+		return &http.Client{
+			Transport: &archiveTransport{base: transport, dir: opts.ArchiveDir},
+			Timeout:   opts.Timeout,
+		}
+	}
+	return &http.Client{Transport: transport, Timeout: opts.Timeout}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// configSchema describes the expected shape of a JSON value in the
+// configuration file.
+type configSchema struct {
+	// Kind is one of "object", "array", "string", "number", "boolean"
+	// or "any".
+	Kind string
+	// Properties lists the allowed keys of an object with fixed keys.
+	Properties map[string]*configSchema
+	// Required lists the keys that must be present in such an object.
+	Required []string
+	// Values, if set, makes the object a map with arbitrary keys.
+	Values *configSchema
+	// Items describes the elements of an array.
+	Items *configSchema
+	// Check, if set, validates a string, number or boolean value further.
+	Check func(value interface{}) error
+}
+
+// aliasSchema mirrors the alias type.
+var aliasSchema = &configSchema{
+	Kind: "object",
+	Properties: map[string]*configSchema{
+		"script":       {Kind: "string"},
+		"deployment":   {Kind: "string"},
+		"function":     {Kind: "string"},
+		"parameters":   {Kind: "array", Items: &configSchema{Kind: "any"}},
+		"devMode":      {Kind: "boolean"},
+		"resultSchema": {Kind: "object", Values: &configSchema{Kind: "any"}},
+	},
+	Required: []string{"script", "function"},
+}
+
+// environmentSchema mirrors the environment type. Its aliases have the
+// fields of aliasSchema, none of them required.
+var environmentSchema = &configSchema{
+	Kind: "object",
+	Properties: map[string]*configSchema{
+		"script": {Kind: "string"},
+		"aliases": {Kind: "object", Values: &configSchema{
+			Kind:       "object",
+			Properties: aliasSchema.Properties,
+		}},
+	},
+}
+
+// historyRetentionSchema mirrors the historyRetention type.
+var historyRetentionSchema = &configSchema{
+	Kind: "object",
+	Properties: map[string]*configSchema{
+		"maxAge":   {Kind: "string", Check: checkAge},
+		"maxRows":  {Kind: "number", Check: checkCount},
+		"maxBytes": {Kind: "number", Check: checkCount},
+	},
+}
+
+// checkConfigSchema mirrors the checkConfig type.
+var checkConfigSchema = &configSchema{
+	Kind: "object",
+	Properties: map[string]*configSchema{
+		"alias":      {Kind: "string"},
+		"parameters": {Kind: "array", Items: &configSchema{Kind: "any"}},
+		"expect":     {Kind: "any"},
+		"timeout":    {Kind: "string", Check: checkAge},
+	},
+	Required: []string{"alias"},
+}
+
+// profileConfigSchema mirrors the profileConfig type.
+var profileConfigSchema = &configSchema{
+	Kind: "object",
+	Properties: map[string]*configSchema{
+		"dialTimeout":           {Kind: "string", Check: checkTimeout},
+		"tlsHandshakeTimeout":   {Kind: "string", Check: checkTimeout},
+		"responseHeaderTimeout": {Kind: "string", Check: checkTimeout},
+		"timeout":               {Kind: "string", Check: checkTimeout},
+	},
+}
+
+// appConfigSchema mirrors the appConfig type.
+var appConfigSchema = &configSchema{
+	Kind: "object",
+	Properties: map[string]*configSchema{
+		"aliases":      {Kind: "object", Values: aliasSchema},
+		"environments": {Kind: "object", Values: environmentSchema},
+		"checks":       {Kind: "object", Values: checkConfigSchema},
+		"profiles":     {Kind: "object", Values: profileConfigSchema},
+		"history":      historyRetentionSchema,
+		"archive": {Kind: "object", Properties: map[string]*configSchema{
+			"dir": {Kind: "string"},
+		}},
+	},
+}
+
+// checkAge accepts durations understood by parseAge.
+func checkAge(value interface{}) error {
+	_, err := parseAge(value.(string))
+	return err
+}
+
+// checkTimeout accepts durations understood by parseTimeout.
+func checkTimeout(value interface{}) error {
+	_, err := parseTimeout(value.(string))
+	return err
+}
+
+// checkCount accepts non-negative integers.
+func checkCount(value interface{}) error {
+	if n := value.(float64); n < 0 || n != float64(int64(n)) {
+		return fmt.Errorf("expected a non-negative integer, found %v", n)
+	}
+	return nil
+}
+
+// jsonNode is a parsed JSON value that remembers where it was found.
+type jsonNode struct {
+	Kind   string
+	Offset int64
+	Fields []*jsonField
+	Items  []*jsonNode
+	Value  interface{}
+}
+
+// jsonField is a key and value of a JSON object.
+type jsonField struct {
+	Key    string
+	Offset int64
+	Value  *jsonNode
+}
+
+// field returns the value of the given key, or nil.
+func (n *jsonNode) field(key string) *jsonNode {
+	if n == nil {
+		return nil
+	}
+	for _, f := range n.Fields {
+		if f.Key == key {
+			return f.Value
+		}
+	}
+	return nil
+}
+
+// parseJSONNode reads the next JSON value from dec.
+func parseJSONNode(dec *json.Decoder) (*jsonNode, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	n := &jsonNode{Offset: dec.InputOffset(), Value: tok}
+	switch t := tok.(type) {
+	case json.Delim:
+		n.Value = nil
+		if t == '{' {
+			n.Kind = "object"
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				f := &jsonField{Key: key.(string), Offset: dec.InputOffset()}
+				if f.Value, err = parseJSONNode(dec); err != nil {
+					return nil, err
+				}
+				n.Fields = append(n.Fields, f)
+			}
+		} else {
+			n.Kind = "array"
+			for dec.More() {
+				item, err := parseJSONNode(dec)
+				if err != nil {
+					return nil, err
+				}
+				n.Items = append(n.Items, item)
+			}
+		}
+		// Consume the closing delimiter.
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	case string:
+		n.Kind = "string"
+	case float64:
+		n.Kind = "number"
+	case bool:
+		n.Kind = "boolean"
+	case nil:
+		n.Kind = "null"
+	}
+	return n, nil
+}
+
+// configDiagnostic is a problem found in the configuration file.
+// Warnings are printed but do not make the file invalid.
+type configDiagnostic struct {
+	Offset  int64
+	Path    string
+	Message string
+	Warning bool
+}
+
+// configValidator collects diagnostics for one configuration file.
+type configValidator struct {
+	data        []byte
+	diagnostics []configDiagnostic
+}
+
+// addf records a diagnostic at the given offset.
+func (v *configValidator) addf(offset int64, path, format string, args ...interface{}) {
+	v.diagnostics = append(v.diagnostics, configDiagnostic{
+		Offset:  offset,
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// warnf records a warning at the given offset.
+func (v *configValidator) warnf(offset int64, path, format string, args ...interface{}) {
+	v.addf(offset, path, format, args...)
+	v.diagnostics[len(v.diagnostics)-1].Warning = true
+}
+
+// line returns the 1-based line number of the given offset.
+func (v *configValidator) line(offset int64) int {
+	if offset > int64(len(v.data)) {
+		offset = int64(len(v.data))
+	}
+	return bytes.Count(v.data[:offset], []byte("\n")) + 1
+}
+
+// check validates n against s. path names n for diagnostics.
+func (v *configValidator) check(n *jsonNode, s *configSchema, path string) {
+	if s.Kind != "any" && n.Kind != s.Kind {
+		v.addf(n.Offset, path, "expected %s, found %s", s.Kind, n.Kind)
+		return
+	}
+	switch n.Kind {
+	case "object":
+		seen := map[string]bool{}
+		for _, f := range n.Fields {
+			p := joinPath(path, f.Key)
+			if seen[f.Key] {
+				v.addf(f.Offset, p, "duplicate key %q", f.Key)
+			}
+			seen[f.Key] = true
+			switch {
+			case s.Values != nil:
+				v.check(f.Value, s.Values, p)
+			case s.Properties[f.Key] != nil:
+				v.check(f.Value, s.Properties[f.Key], p)
+			case s.Kind != "any":
+				v.addf(f.Offset, p, "unknown key %q%s", f.Key, suggestKey(f.Key, s.Properties))
+			}
+		}
+		for _, key := range s.Required {
+			if !seen[key] {
+				v.addf(n.Offset, path, "missing required key %q", key)
+			}
+		}
+	case "array":
+		if s.Items == nil {
+			return
+		}
+		for i, item := range n.Items {
+			v.check(item, s.Items, fmt.Sprintf("%s[%d]", path, i))
+		}
+	default:
+		if s.Check == nil {
+			return
+		}
+		if err := s.Check(n.Value); err != nil {
+			v.addf(n.Offset, path, "%v", err)
+		}
+	}
+}
+
+// checkEnvironments reports environment aliases that are not defined at
+// the top level and lack a function, or a script when the environment
+// has none either. It warns about top-level aliases that keep their own
+// script in an environment that sets one, since the environment's script
+// does not apply to them.
+func (v *configValidator) checkEnvironments(root *jsonNode) {
+	aliases := root.field("aliases")
+	envs := root.field("environments")
+	if envs == nil || envs.Kind != "object" {
+		return
+	}
+	for _, env := range envs.Fields {
+		overrides := env.Value.field("aliases")
+		if script := env.Value.field("script"); script != nil && aliases != nil && aliases.Kind == "object" {
+			for _, a := range aliases.Fields {
+				if overrides.field(a.Key).field("script") == nil {
+					v.warnf(script.Offset, joinPath("environments."+env.Key, "script"),
+						"alias %q keeps its top-level script; set environments.%s.aliases.%s.script to run it in this environment",
+						a.Key, env.Key, a.Key)
+				}
+			}
+		}
+		if overrides == nil || overrides.Kind != "object" {
+			continue
+		}
+		for _, o := range overrides.Fields {
+			if aliases.field(o.Key) != nil {
+				continue
+			}
+			for _, key := range aliasSchema.Required {
+				if key == "script" && env.Value.field("script") != nil {
+					continue
+				}
+				if o.Value.field(key) == nil {
+					v.addf(o.Offset, joinPath("environments."+env.Key+".aliases", o.Key),
+						"alias %q is not defined in aliases and has no %q", o.Key, key)
+				}
+			}
+		}
+	}
+}
+
+// checkAliasReferences reports checks that refer to undefined aliases.
+// Aliases defined only in environments count, since they exist when the
+// check is run with -env.
+func (v *configValidator) checkAliasReferences(root *jsonNode) {
+	checks := root.field("checks")
+	if checks == nil || checks.Kind != "object" {
+		return
+	}
+	defined := map[string]bool{}
+	if aliases := root.field("aliases"); aliases != nil {
+		for _, f := range aliases.Fields {
+			defined[f.Key] = true
+		}
+	}
+	if envs := root.field("environments"); envs != nil {
+		for _, env := range envs.Fields {
+			if aliases := env.Value.field("aliases"); aliases != nil {
+				for _, f := range aliases.Fields {
+					defined[f.Key] = true
+				}
+			}
+		}
+	}
+	for _, c := range checks.Fields {
+		ref := c.Value.field("alias")
+		if ref == nil || ref.Kind != "string" {
+			continue
+		}
+		if name := ref.Value.(string); !defined[name] {
+			v.addf(ref.Offset, joinPath("checks."+c.Key, "alias"), "undefined alias %q", name)
+		}
+	}
+}
+
+// joinPath appends key to a dotted path.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// suggestKey returns a hint naming a known key that differs from key
+// only in case, or nothing.
+func suggestKey(key string, properties map[string]*configSchema) string {
+	for known := range properties {
+		if strings.EqualFold(known, key) {
+			return fmt.Sprintf(" (did you mean %q?)", known)
+		}
+	}
+	return ""
+}
+
+// validateConfig checks the configuration file and prints a diagnostic
+// per line for every problem found. It returns whether the file is valid,
+// which warnings do not affect.
+func validateConfig(file string) bool {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Printf("%s: %v\n", file, err)
+		return false
+	}
+	v := &configValidator{data: b}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	root, err := parseJSONNode(dec)
+	if err == nil {
+		if _, extra := dec.Token(); extra != io.EOF {
+			err = fmt.Errorf("unexpected data after the top-level value")
+		}
+	}
+	if err != nil {
+		offset := dec.InputOffset()
+		if serr, ok := err.(*json.SyntaxError); ok {
+			offset = serr.Offset
+		}
+		v.addf(offset, "", "%v", err)
+	} else {
+		v.check(root, appConfigSchema, "")
+		v.checkEnvironments(root)
+		v.checkAliasReferences(root)
+	}
+
+	sort.SliceStable(v.diagnostics, func(i, j int) bool {
+		return v.diagnostics[i].Offset < v.diagnostics[j].Offset
+	})
+	valid := true
+	for _, d := range v.diagnostics {
+		msg := d.Message
+		if d.Warning {
+			msg = "warning: " + msg
+		} else {
+			valid = false
+		}
+		if d.Path == "" {
+			fmt.Printf("%s:%d: %s\n", file, v.line(d.Offset), msg)
+		} else {
+			fmt.Printf("%s:%d: %s: %s\n", file, v.line(d.Offset), d.Path, msg)
+		}
+	}
+	if !valid {
+		return false
+	}
+	fmt.Printf("%s: OK\n", file)
+	return true
+}